@@ -0,0 +1,185 @@
+package salesforce_logs_receiver
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// AuthMode selects how SalesforceLogsReceiver authenticates against the Salesforce API.
+type AuthMode string
+
+const (
+	// AuthModePassword authenticates with a username, password and security token.
+	AuthModePassword AuthMode = "password"
+	// AuthModeJWT authenticates with the OAuth 2.0 JWT bearer token flow, signing an
+	// assertion with an RSA private key registered on a connected app. This is required for
+	// orgs where password-based logins are disabled, and removes the need to rotate a
+	// security token.
+	AuthModeJWT AuthMode = "jwt"
+
+	jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	jwtAssertionExpiry = 3 * time.Minute
+)
+
+// AuthConfig holds the credentials needed for one of the supported Salesforce authentication
+// flows, selected by Mode.
+type AuthConfig struct {
+	Mode AuthMode
+
+	// Username, Password and SecurityToken are used when Mode is AuthModePassword.
+	Username      string
+	Password      string
+	SecurityToken string
+
+	// PrivateKeyPEM, ConsumerKey, Subject and Audience are used when Mode is AuthModeJWT.
+	// Audience is optional and defaults to the receiver's login URL.
+	PrivateKeyPEM string
+	ConsumerKey   string
+	Subject       string
+	Audience      string
+}
+
+func (auth AuthConfig) validate() error {
+	switch auth.Mode {
+	case "", AuthModePassword:
+		if auth.Username == "" {
+			return fmt.Errorf("username must have a value")
+		}
+		if auth.Password == "" {
+			return fmt.Errorf("password must have a value")
+		}
+		if auth.SecurityToken == "" {
+			return fmt.Errorf("security token must have a value")
+		}
+	case AuthModeJWT:
+		if auth.ConsumerKey == "" {
+			return fmt.Errorf("consumer key must have a value")
+		}
+		if auth.Subject == "" {
+			return fmt.Errorf("subject must have a value")
+		}
+		if auth.PrivateKeyPEM == "" {
+			return fmt.Errorf("private key must have a value")
+		}
+	default:
+		return fmt.Errorf("auth mode must be %q or %q", AuthModePassword, AuthModeJWT)
+	}
+
+	return nil
+}
+
+// jwtTokenResponse is the subset of Salesforce's OAuth 2.0 token endpoint response relevant
+// to the JWT bearer flow.
+type jwtTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	InstanceURL      string `json:"instance_url"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// loginJWT authenticates via the OAuth 2.0 JWT bearer token flow: a signed assertion is
+// exchanged with Salesforce's token endpoint for an access token and instance URL, which are
+// then set directly on the underlying simpleforce client.
+func (slr *SalesforceLogsReceiver) loginJWT() error {
+	assertion, err := buildJWTAssertion(slr.auth, slr.url)
+	if err != nil {
+		return fmt.Errorf("error building JWT assertion: %w", err)
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", jwtBearerGrantType)
+	form.Set("assertion", assertion)
+
+	resp, err := http.PostForm(strings.TrimRight(slr.url, "/")+"/services/oauth2/token", form)
+	if err != nil {
+		return fmt.Errorf("error calling Salesforce token endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResp jwtTokenResponse
+	if err = json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return fmt.Errorf("error decoding Salesforce token response: %w", err)
+	}
+
+	if tokenResp.Error != "" {
+		return fmt.Errorf("error authenticating with JWT bearer flow: %s: %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+
+	slr.client.SetSidLoc(tokenResp.AccessToken, tokenResp.InstanceURL)
+	return nil
+}
+
+// buildJWTAssertion builds and signs an RS256 JWT bearer assertion per Salesforce's OAuth 2.0
+// JWT bearer token flow. loginURL is used as the audience unless auth.Audience overrides it.
+func buildJWTAssertion(auth AuthConfig, loginURL string) (string, error) {
+	privateKey, err := parseRSAPrivateKey(auth.PrivateKeyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	audience := loginURL
+	if auth.Audience != "" {
+		audience = auth.Audience
+	}
+
+	header := base64URLEncode([]byte(`{"alg":"RS256"}`))
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss": auth.ConsumerKey,
+		"sub": auth.Subject,
+		"aud": audience,
+		"exp": time.Now().Add(jwtAssertionExpiry).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error marshaling JWT claims: %w", err)
+	}
+
+	signingInput := header + "." + base64URLEncode(claims)
+
+	hashed := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("error signing JWT assertion: %w", err)
+	}
+
+	return signingInput + "." + base64URLEncode(signature), nil
+}
+
+// parseRSAPrivateKey parses an RSA private key in either PKCS#1 or PKCS#8 PEM encoding.
+func parseRSAPrivateKey(pemData string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, fmt.Errorf("error decoding PEM block from private key")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing private key: %w", err)
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+func base64URLEncode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
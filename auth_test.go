@@ -0,0 +1,187 @@
+package salesforce_logs_receiver
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+func generateTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() error = %v", err)
+	}
+
+	return key
+}
+
+func pemEncodePKCS1(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+	return string(pem.EncodeToMemory(block))
+}
+
+func pemEncodePKCS8(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	bytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKCS8PrivateKey() error = %v", err)
+	}
+
+	block := &pem.Block{Type: "PRIVATE KEY", Bytes: bytes}
+	return string(pem.EncodeToMemory(block))
+}
+
+func TestParseRSAPrivateKey(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	t.Run("PKCS1", func(t *testing.T) {
+		parsed, err := parseRSAPrivateKey(pemEncodePKCS1(t, key))
+		if err != nil {
+			t.Fatalf("parseRSAPrivateKey() error = %v", err)
+		}
+		if !parsed.Equal(key) {
+			t.Errorf("parseRSAPrivateKey() returned a different key")
+		}
+	})
+
+	t.Run("PKCS8", func(t *testing.T) {
+		parsed, err := parseRSAPrivateKey(pemEncodePKCS8(t, key))
+		if err != nil {
+			t.Fatalf("parseRSAPrivateKey() error = %v", err)
+		}
+		if !parsed.Equal(key) {
+			t.Errorf("parseRSAPrivateKey() returned a different key")
+		}
+	})
+
+	t.Run("invalid PEM", func(t *testing.T) {
+		if _, err := parseRSAPrivateKey("not a pem block"); err == nil {
+			t.Error("parseRSAPrivateKey() error = nil, want error")
+		}
+	})
+}
+
+func TestBase64URLEncode(t *testing.T) {
+	got := base64URLEncode([]byte(`{"alg":"RS256"}`))
+	if strings.ContainsAny(got, "+/=") {
+		t.Errorf("base64URLEncode() = %q, contains non-URL-safe characters", got)
+	}
+
+	want := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	if got != want {
+		t.Errorf("base64URLEncode() = %q, want %q", got, want)
+	}
+}
+
+func TestBuildJWTAssertion(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	auth := AuthConfig{
+		Mode:          AuthModeJWT,
+		ConsumerKey:   "3MVG9...",
+		Subject:       "user@example.com",
+		PrivateKeyPEM: pemEncodePKCS8(t, key),
+	}
+
+	assertion, err := buildJWTAssertion(auth, "https://login.salesforce.com")
+	if err != nil {
+		t.Fatalf("buildJWTAssertion() error = %v", err)
+	}
+
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		t.Fatalf("buildJWTAssertion() = %q, want 3 dot-separated parts", assertion)
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		t.Fatalf("error decoding header: %v", err)
+	}
+	if string(headerJSON) != `{"alg":"RS256"}` {
+		t.Errorf("header = %s, want %s", headerJSON, `{"alg":"RS256"}`)
+	}
+
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("error decoding claims: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err = json.Unmarshal(claimsJSON, &claims); err != nil {
+		t.Fatalf("error unmarshaling claims: %v", err)
+	}
+	if claims["iss"] != auth.ConsumerKey {
+		t.Errorf("claims[iss] = %v, want %v", claims["iss"], auth.ConsumerKey)
+	}
+	if claims["sub"] != auth.Subject {
+		t.Errorf("claims[sub] = %v, want %v", claims["sub"], auth.Subject)
+	}
+	if claims["aud"] != "https://login.salesforce.com" {
+		t.Errorf("claims[aud] = %v, want %v", claims["aud"], "https://login.salesforce.com")
+	}
+}
+
+func TestBuildJWTAssertionCustomAudience(t *testing.T) {
+	key := generateTestRSAKey(t)
+
+	auth := AuthConfig{
+		Mode:          AuthModeJWT,
+		ConsumerKey:   "3MVG9...",
+		Subject:       "user@example.com",
+		PrivateKeyPEM: pemEncodePKCS8(t, key),
+		Audience:      "https://test.salesforce.com",
+	}
+
+	assertion, err := buildJWTAssertion(auth, "https://login.salesforce.com")
+	if err != nil {
+		t.Fatalf("buildJWTAssertion() error = %v", err)
+	}
+
+	parts := strings.Split(assertion, ".")
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("error decoding claims: %v", err)
+	}
+
+	var claims map[string]interface{}
+	if err = json.Unmarshal(claimsJSON, &claims); err != nil {
+		t.Fatalf("error unmarshaling claims: %v", err)
+	}
+	if claims["aud"] != auth.Audience {
+		t.Errorf("claims[aud] = %v, want %v (auth.Audience should override loginURL)", claims["aud"], auth.Audience)
+	}
+}
+
+func TestAuthConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		auth    AuthConfig
+		wantErr bool
+	}{
+		{name: "valid password mode", auth: AuthConfig{Mode: AuthModePassword, Username: "u", Password: "p", SecurityToken: "t"}, wantErr: false},
+		{name: "default mode treated as password", auth: AuthConfig{Username: "u", Password: "p", SecurityToken: "t"}, wantErr: false},
+		{name: "password mode missing username", auth: AuthConfig{Mode: AuthModePassword, Password: "p", SecurityToken: "t"}, wantErr: true},
+		{name: "valid JWT mode", auth: AuthConfig{Mode: AuthModeJWT, ConsumerKey: "c", Subject: "s", PrivateKeyPEM: "k"}, wantErr: false},
+		{name: "JWT mode missing private key", auth: AuthConfig{Mode: AuthModeJWT, ConsumerKey: "c", Subject: "s"}, wantErr: true},
+		{name: "unknown mode", auth: AuthConfig{Mode: "bogus"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.auth.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
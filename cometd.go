@@ -0,0 +1,330 @@
+package salesforce_logs_receiver
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	cometDHandshakeChannel = "/meta/handshake"
+	cometDConnectChannel   = "/meta/connect"
+	cometDSubscribeChannel = "/meta/subscribe"
+	cometDConnectionType   = "long-polling"
+	cometDReconnectDelay   = 5 * time.Second
+
+	// replayNewEvents tells Salesforce to only deliver events created after the
+	// subscription is made, used when no replayId has been persisted yet.
+	replayNewEvents = -1
+
+	// cometDInvalidSessionErrorPrefix is the Bayeux advice code Salesforce puts at the start
+	// of a message's "error" field when the session id used to authenticate CometD requests
+	// has expired or been revoked, e.g. "401::Authentication invalid".
+	cometDInvalidSessionErrorPrefix = "401::"
+)
+
+// StreamEvent is a single message delivered from a Salesforce Streaming API channel
+// (PushTopic, Generic, Platform Event or Change Data Capture).
+type StreamEvent struct {
+	Channel  string
+	ReplayID int64
+	Data     map[string]interface{}
+}
+
+// Subscriber subscribes to one or more Salesforce Streaming API channels over CometD and
+// delivers messages on a Go channel, giving near-real-time delivery alongside the existing
+// EventLogFile polling loop.
+type Subscriber struct {
+	slr      *SalesforceLogsReceiver
+	channels []string
+	cursor   Cursor
+	client   *http.Client
+	clientID string
+}
+
+// NewSubscriber creates a Subscriber for the given Streaming API channels (e.g.
+// "/event/MyEvent__e" or "/topic/MyTopic"). cursor persists each channel's replayId so a
+// restarted subscriber resumes from where it left off instead of replaying everything or
+// missing events in between.
+func (slr *SalesforceLogsReceiver) NewSubscriber(channels []string, cursor Cursor) *Subscriber {
+	return &Subscriber{
+		slr:      slr,
+		channels: channels,
+		cursor:   cursor,
+		client:   &http.Client{},
+	}
+}
+
+// Run performs the CometD handshake and subscriptions, then connects in a loop, delivering
+// messages on events until stop is closed. Long-polling connections are expected to drop
+// periodically, so a connect error triggers a re-handshake and re-subscribe rather than
+// aborting the subscription; if the session itself expired, it re-logs-in to Salesforce first
+// rather than retrying with the same stale token forever.
+func (s *Subscriber) Run(stop <-chan struct{}, events chan<- StreamEvent) error {
+	if err := s.handshake(); err != nil {
+		s.reLoginIfUnauthorized(err)
+		return fmt.Errorf("error performing CometD handshake: %w", err)
+	}
+
+	if err := s.subscribe(); err != nil {
+		s.reLoginIfUnauthorized(err)
+		return fmt.Errorf("error subscribing to streaming channels: %w", err)
+	}
+
+	for {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		messages, err := s.connect()
+		if err != nil {
+			s.slr.logger.Debug("CometD connect error, reconnecting", zap.Error(err))
+			s.reLoginIfUnauthorized(err)
+			time.Sleep(cometDReconnectDelay)
+
+			if err = s.handshake(); err != nil {
+				s.reLoginIfUnauthorized(err)
+				return fmt.Errorf("error re-handshaking with CometD: %w", err)
+			}
+			if err = s.subscribe(); err != nil {
+				s.reLoginIfUnauthorized(err)
+				return fmt.Errorf("error re-subscribing to streaming channels: %w", err)
+			}
+
+			continue
+		}
+
+		for _, message := range messages {
+			s.deliver(message, events)
+		}
+	}
+}
+
+// reLoginIfUnauthorized re-authenticates against Salesforce when err indicates the CometD
+// session id was rejected, mirroring salesforceCollector.reLoginIfUnauthorized on the polling
+// side, so a long-lived subscription recovers from session expiry instead of looping forever
+// against a stale token.
+func (s *Subscriber) reLoginIfUnauthorized(err error) {
+	if !errors.Is(err, ErrUnauthorized) {
+		return
+	}
+
+	s.slr.logger.Info("CometD session rejected, logging in to Salesforce again")
+	if loginErr := s.slr.LoginSalesforce(); loginErr != nil {
+		s.slr.logger.Error("error logging in to Salesforce again", zap.Error(loginErr))
+	}
+}
+
+type cometDMessage struct {
+	Channel                  string                 `json:"channel"`
+	ClientID                 string                 `json:"clientId,omitempty"`
+	Subscription             string                 `json:"subscription,omitempty"`
+	ConnectionType           string                 `json:"connectionType,omitempty"`
+	Version                  string                 `json:"version,omitempty"`
+	MinimumVersion           string                 `json:"minimumVersion,omitempty"`
+	SupportedConnectionTypes []string               `json:"supportedConnectionTypes,omitempty"`
+	Successful               bool                   `json:"successful,omitempty"`
+	Ext                      map[string]interface{} `json:"ext,omitempty"`
+	Data                     map[string]interface{} `json:"data,omitempty"`
+	Error                    string                 `json:"error,omitempty"`
+}
+
+func (s *Subscriber) handshake() error {
+	request := []cometDMessage{{
+		Channel:                  cometDHandshakeChannel,
+		Version:                  "1.0",
+		MinimumVersion:           "1.0",
+		SupportedConnectionTypes: []string{cometDConnectionType},
+	}}
+
+	responses, err := s.post(request)
+	if err != nil {
+		return err
+	}
+
+	if len(responses) == 0 || !responses[0].Successful {
+		if len(responses) > 0 && isCometDInvalidSessionError(responses[0].Error) {
+			return fmt.Errorf("%w: %s", ErrUnauthorized, responses[0].Error)
+		}
+
+		return fmt.Errorf("CometD handshake was not successful")
+	}
+
+	s.clientID = responses[0].ClientID
+	return nil
+}
+
+func (s *Subscriber) subscribe() error {
+	var request []cometDMessage
+	for _, channel := range s.channels {
+		replayID, err := s.loadReplayID(channel)
+		if err != nil {
+			return err
+		}
+
+		request = append(request, cometDMessage{
+			Channel:      cometDSubscribeChannel,
+			ClientID:     s.clientID,
+			Subscription: channel,
+			Ext: map[string]interface{}{
+				"replay": map[string]interface{}{channel: replayID},
+			},
+		})
+	}
+
+	responses, err := s.post(request)
+	if err != nil {
+		return err
+	}
+
+	for _, response := range responses {
+		if !response.Successful {
+			if isCometDInvalidSessionError(response.Error) {
+				return fmt.Errorf("%w: %s", ErrUnauthorized, response.Error)
+			}
+
+			return fmt.Errorf("error subscribing to channel %s: %s", response.Subscription, response.Error)
+		}
+	}
+
+	return nil
+}
+
+func (s *Subscriber) connect() ([]cometDMessage, error) {
+	request := []cometDMessage{{
+		Channel:        cometDConnectChannel,
+		ClientID:       s.clientID,
+		ConnectionType: cometDConnectionType,
+	}}
+
+	responses, err := s.post(request)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, response := range responses {
+		if response.Channel == cometDConnectChannel && !response.Successful && isCometDInvalidSessionError(response.Error) {
+			return nil, fmt.Errorf("%w: %s", ErrUnauthorized, response.Error)
+		}
+	}
+
+	return responses, nil
+}
+
+// isCometDInvalidSessionError reports whether a CometD message's error field indicates the
+// session id used to authenticate was rejected, which Salesforce reports at the message level
+// (HTTP 200) rather than as an HTTP-level 401.
+func isCometDInvalidSessionError(errMsg string) bool {
+	return strings.HasPrefix(errMsg, cometDInvalidSessionErrorPrefix)
+}
+
+func (s *Subscriber) post(request []cometDMessage) ([]cometDMessage, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling CometD request: %w", err)
+	}
+
+	s.slr.clientMutex.RLock()
+	apiPath := fmt.Sprintf("%s/cometd/%s/", strings.TrimRight(s.slr.client.GetLoc(), "/"), s.slr.apiVersion)
+	req, err := http.NewRequest("POST", apiPath, bytes.NewReader(body))
+	if err == nil {
+		req.Header.Add("Authorization", "Bearer "+s.slr.client.GetSid())
+	}
+	s.slr.clientMutex.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("error creating CometD request: %w", err)
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err = buf.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		statusErr := &HTTPStatusError{StatusCode: resp.StatusCode, Body: buf.String()}
+		if resp.StatusCode == http.StatusUnauthorized {
+			return nil, fmt.Errorf("%w: %s", ErrUnauthorized, statusErr)
+		}
+
+		return nil, statusErr
+	}
+
+	var responses []cometDMessage
+	if err = json.Unmarshal(buf.Bytes(), &responses); err != nil {
+		return nil, fmt.Errorf("error unmarshaling CometD response: %w", err)
+	}
+
+	return responses, nil
+}
+
+func (s *Subscriber) deliver(message cometDMessage, events chan<- StreamEvent) {
+	if message.Data == nil || strings.HasPrefix(message.Channel, "/meta/") {
+		return
+	}
+
+	replayID := replayIDFromData(message.Data)
+
+	events <- StreamEvent{
+		Channel:  message.Channel,
+		ReplayID: replayID,
+		Data:     message.Data,
+	}
+
+	if err := s.cursor.Save(s.cursorKey(message.Channel), strconv.FormatInt(replayID, 10)); err != nil {
+		s.slr.logger.Debug("error saving replayId cursor for channel",
+			zap.String("event_type", message.Channel), zap.Error(err))
+	}
+}
+
+func (s *Subscriber) loadReplayID(channel string) (int64, error) {
+	stored, err := s.cursor.Load(s.cursorKey(channel))
+	if err != nil {
+		return 0, fmt.Errorf("error loading replayId cursor for channel %s: %w", channel, err)
+	}
+
+	if stored == "" {
+		return replayNewEvents, nil
+	}
+
+	replayID, err := strconv.ParseInt(stored, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing replayId cursor for channel %s: %w", channel, err)
+	}
+
+	return replayID, nil
+}
+
+func (s *Subscriber) cursorKey(channel string) string {
+	return "streaming:" + channel
+}
+
+func replayIDFromData(data map[string]interface{}) int64 {
+	event, ok := data["event"].(map[string]interface{})
+	if !ok {
+		return 0
+	}
+
+	replayID, ok := event["replayId"].(float64)
+	if !ok {
+		return 0
+	}
+
+	return int64(replayID)
+}
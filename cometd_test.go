@@ -0,0 +1,96 @@
+package salesforce_logs_receiver
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestReplayIDFromData(t *testing.T) {
+	tests := []struct {
+		name string
+		data map[string]interface{}
+		want int64
+	}{
+		{
+			name: "valid replayId",
+			data: map[string]interface{}{"event": map[string]interface{}{"replayId": float64(42)}},
+			want: 42,
+		},
+		{name: "missing event", data: map[string]interface{}{}, want: 0},
+		{name: "event not a map", data: map[string]interface{}{"event": "oops"}, want: 0},
+		{name: "replayId not a number", data: map[string]interface{}{"event": map[string]interface{}{"replayId": "42"}}, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replayIDFromData(tt.data); got != tt.want {
+				t.Errorf("replayIDFromData(%v) = %d, want %d", tt.data, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubscriberCursorKey(t *testing.T) {
+	s := &Subscriber{}
+
+	got := s.cursorKey("/event/MyEvent__e")
+	want := "streaming:/event/MyEvent__e"
+	if got != want {
+		t.Errorf("cursorKey() = %q, want %q", got, want)
+	}
+}
+
+func TestIsCometDInvalidSessionError(t *testing.T) {
+	tests := []struct {
+		name    string
+		errMsg  string
+		invalid bool
+	}{
+		{name: "invalid session", errMsg: "401::Authentication invalid", invalid: true},
+		{name: "unrelated error", errMsg: "403::Handshake denied", invalid: false},
+		{name: "empty", errMsg: "", invalid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isCometDInvalidSessionError(tt.errMsg); got != tt.invalid {
+				t.Errorf("isCometDInvalidSessionError(%q) = %v, want %v", tt.errMsg, got, tt.invalid)
+			}
+		})
+	}
+}
+
+func TestCometDMessageMarshaling(t *testing.T) {
+	message := cometDMessage{
+		Channel:                  cometDHandshakeChannel,
+		Version:                  "1.0",
+		MinimumVersion:           "1.0",
+		SupportedConnectionTypes: []string{cometDConnectionType},
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+
+	var roundTripped cometDMessage
+	if err = json.Unmarshal(data, &roundTripped); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+
+	if !reflect.DeepEqual(roundTripped, message) {
+		t.Errorf("round-tripped message = %+v, want %+v", roundTripped, message)
+	}
+
+	var raw map[string]interface{}
+	if err = json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("json.Unmarshal() into map error = %v", err)
+	}
+	if _, present := raw["clientId"]; present {
+		t.Errorf("clientId present in marshaled output %s, want omitted when empty", data)
+	}
+	if _, present := raw["successful"]; present {
+		t.Errorf("successful present in marshaled output %s, want omitted when false", data)
+	}
+}
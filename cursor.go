@@ -0,0 +1,109 @@
+package salesforce_logs_receiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Cursor persists the latest processed timestamp per sObject type so a restarted collector
+// can resume where it left off instead of replaying (or missing) records.
+type Cursor interface {
+	Load(sObjectType string) (string, error)
+	Save(sObjectType string, timestamp string) error
+}
+
+// MemoryCursor is an in-memory Cursor implementation. It does not survive a process restart
+// and is intended for tests and other short-lived use.
+type MemoryCursor struct {
+	mutex      sync.Mutex
+	timestamps map[string]string
+}
+
+func NewMemoryCursor() *MemoryCursor {
+	return &MemoryCursor{timestamps: make(map[string]string)}
+}
+
+func (c *MemoryCursor) Load(sObjectType string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.timestamps[sObjectType], nil
+}
+
+func (c *MemoryCursor) Save(sObjectType string, timestamp string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.timestamps[sObjectType] = timestamp
+	return nil
+}
+
+// FileCursor is a Cursor implementation backed by a JSON file on disk, keyed by sObject type.
+type FileCursor struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewFileCursor(path string) *FileCursor {
+	return &FileCursor{path: path}
+}
+
+func (c *FileCursor) Load(sObjectType string) (string, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timestamps, err := c.readAll()
+	if err != nil {
+		return "", err
+	}
+
+	return timestamps[sObjectType], nil
+}
+
+func (c *FileCursor) Save(sObjectType string, timestamp string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	timestamps, err := c.readAll()
+	if err != nil {
+		return err
+	}
+
+	timestamps[sObjectType] = timestamp
+
+	data, err := json.Marshal(timestamps)
+	if err != nil {
+		return fmt.Errorf("error marshaling cursor data: %w", err)
+	}
+
+	if err = os.WriteFile(c.path, data, 0644); err != nil {
+		return fmt.Errorf("error writing cursor file %s: %w", c.path, err)
+	}
+
+	return nil
+}
+
+func (c *FileCursor) readAll() (map[string]string, error) {
+	timestamps := make(map[string]string)
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return timestamps, nil
+		}
+
+		return nil, fmt.Errorf("error reading cursor file %s: %w", c.path, err)
+	}
+
+	if len(data) == 0 {
+		return timestamps, nil
+	}
+
+	if err = json.Unmarshal(data, &timestamps); err != nil {
+		return nil, fmt.Errorf("error unmarshaling cursor file %s: %w", c.path, err)
+	}
+
+	return timestamps, nil
+}
@@ -0,0 +1,64 @@
+package salesforce_logs_receiver
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMemoryCursorRoundTrip(t *testing.T) {
+	cursor := NewMemoryCursor()
+
+	if got, err := cursor.Load("EventLogFile"); err != nil || got != "" {
+		t.Fatalf("Load() on empty cursor = %q, %v, want \"\", nil", got, err)
+	}
+
+	if err := cursor.Save("EventLogFile", "2023-01-01T00:00:00.000Z"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := cursor.Load("EventLogFile")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got != "2023-01-01T00:00:00.000Z" {
+		t.Errorf("Load() = %q, want %q", got, "2023-01-01T00:00:00.000Z")
+	}
+
+	if got, err := cursor.Load("LoginEvent"); err != nil || got != "" {
+		t.Fatalf("Load() for unsaved sObject type = %q, %v, want \"\", nil", got, err)
+	}
+}
+
+func TestFileCursorRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cursor.json")
+	cursor := NewFileCursor(path)
+
+	if got, err := cursor.Load("EventLogFile"); err != nil || got != "" {
+		t.Fatalf("Load() on missing file = %q, %v, want \"\", nil", got, err)
+	}
+
+	if err := cursor.Save("EventLogFile", "2023-01-01T00:00:00.000Z"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := cursor.Save("LoginEvent", "2023-02-01T00:00:00.000Z"); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	reopened := NewFileCursor(path)
+
+	got, err := reopened.Load("EventLogFile")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got != "2023-01-01T00:00:00.000Z" {
+		t.Errorf("Load(%q) = %q, want %q", "EventLogFile", got, "2023-01-01T00:00:00.000Z")
+	}
+
+	got, err = reopened.Load("LoginEvent")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got != "2023-02-01T00:00:00.000Z" {
+		t.Errorf("Load(%q) = %q, want %q", "LoginEvent", got, "2023-02-01T00:00:00.000Z")
+	}
+}
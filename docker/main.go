@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"os"
 	"strconv"
 	"strings"
@@ -11,77 +15,178 @@ import (
 
 	"github.com/logzio/logzio-go"
 	receiver "github.com/logzio/salesforce-logs-receiver"
+	"github.com/simpleforce/simpleforce"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
 )
 
 const (
-	envNameSalesforceURL     = "SALESFORCE_URL"
-	envNameClientID          = "CLIENT_ID"
-	envNameApiVersion        = "API_VERSION"
-	envNameUsername          = "USERNAME"
-	envNamePassword          = "PASSWORD"
-	envNameSecurityToken     = "SECURITY_TOKEN"
-	envNameSObjectTypes      = "SOBJECT_TYPES"
-	envNameFromTimestamp     = "FROM_TIMESTAMP"
-	envNameInterval          = "INTERVAL"
-	envNameCustomFields      = "CUSTOM_FIELDS"
-	envNameLogzioListenerURL = "LOGZIO_LISTENER_URL"
-	envNameLogzioToken       = "LOGZIO_TOKEN"
-
-	defaultInterval          = 5
-	defaultLogzioListenerURL = "https://listener.logz.io:8071"
-)
-
-var (
-	infoLogger  = log.New(os.Stderr, "INFO: ", log.Ldate|log.Ltime)
-	errorLogger = log.New(os.Stderr, "ERROR: ", log.Ldate|log.Ltime)
+	envNameSalesforceURL          = "SALESFORCE_URL"
+	envNameClientID               = "CLIENT_ID"
+	envNameApiVersion             = "API_VERSION"
+	envNameAuthMode               = "AUTH_MODE"
+	envNameUsername               = "USERNAME"
+	envNamePassword               = "PASSWORD"
+	envNameSecurityToken          = "SECURITY_TOKEN"
+	envNamePrivateKeyPEM          = "PRIVATE_KEY_PEM"
+	envNameConsumerKey            = "CONSUMER_KEY"
+	envNameSubject                = "SUBJECT"
+	envNameAudience               = "AUDIENCE"
+	envNameSObjectTypes           = "SOBJECT_TYPES"
+	envNameSObjectFields          = "SOBJECT_FIELDS"
+	envNameSObjectWhere           = "SOBJECT_WHERE"
+	envNameEventLogEventTypes     = "EVENT_LOG_EVENT_TYPES"
+	envNameEventLogRowFilter      = "EVENT_LOG_ROW_FILTER"
+	envNameFromTimestamp          = "FROM_TIMESTAMP"
+	envNameInterval               = "INTERVAL"
+	envNameCustomFields           = "CUSTOM_FIELDS"
+	envNameLogzioListenerURL      = "LOGZIO_LISTENER_URL"
+	envNameLogzioToken            = "LOGZIO_TOKEN"
+	envNameCursorFilePath         = "CURSOR_FILE_PATH"
+	envNameStreamingChannels      = "STREAMING_CHANNELS"
+	envNameMaxConcurrentDownloads = "MAX_CONCURRENT_DOWNLOADS"
+	envNameLogLevel               = "LOG_LEVEL"
+
+	defaultInterval               = 5
+	defaultLogzioListenerURL      = "https://listener.logz.io:8071"
+	defaultCursorFilePath         = "cursor.json"
+	defaultMaxConcurrentDownloads = 5
 )
 
 type salesforceCollector struct {
 	receiver *receiver.SalesforceLogsReceiver
-	shipper  *logzio.LogzioSender
-	interval int
+	// shipper and streamingShipper are both created once in newSalesforceCollector and kept
+	// open for the life of the process: logzio.LogzioSender.Stop() permanently closes its
+	// underlying disk queue, so neither is ever Stop()'d mid-run.
+	shipper                *logzio.LogzioSender
+	streamingShipper       *logzio.LogzioSender
+	cursor                 receiver.Cursor
+	interval               int
+	maxConcurrentDownloads int
+	logger                 *zap.Logger
 }
 
 func newSalesforceCollector() (*salesforceCollector, error) {
-	rec, err := createSalesforceReceiver()
+	logger, err := createLogger()
+	if err != nil {
+		return nil, fmt.Errorf("error creating logger: %w", err)
+	}
+
+	cursor := createCursor()
+
+	maxConcurrentDownloadsStr := os.Getenv(envNameMaxConcurrentDownloads)
+	maxConcurrentDownloads, err := strconv.Atoi(maxConcurrentDownloadsStr)
+	if err != nil || maxConcurrentDownloads <= 0 {
+		maxConcurrentDownloads = defaultMaxConcurrentDownloads
+	}
+
+	rec, err := createSalesforceReceiver(cursor, logger)
 	if err != nil {
 		return nil, fmt.Errorf("error creating Salesforce receiver: %w", err)
 	}
+	rec.SetDownloadRate(rate.Limit(maxConcurrentDownloads), maxConcurrentDownloads)
 
 	shipper, err := createLogzioSender()
 	if err != nil {
 		return nil, fmt.Errorf("error creating Logz.io sender: %w", err)
 	}
 
+	var streamingShipper *logzio.LogzioSender
+	if len(streamingChannels()) > 0 {
+		if streamingShipper, err = createLogzioSender(); err != nil {
+			return nil, fmt.Errorf("error creating Logz.io sender for streaming: %w", err)
+		}
+	}
+
 	intervalStr := os.Getenv(envNameInterval)
 	interval, err := strconv.Atoi(intervalStr)
 	if err != nil {
-		infoLogger.Println("Interval is not a number. Used default value -", defaultInterval, "seconds")
+		logger.Info("interval is not a number, using default", zap.Int("default_interval_seconds", defaultInterval))
 		interval = defaultInterval
 	}
 
 	if interval <= 0 {
-		infoLogger.Println("Interval is not a positive number. Used default value -", defaultInterval, "seconds")
+		logger.Info("interval is not a positive number, using default", zap.Int("default_interval_seconds", defaultInterval))
 		interval = defaultInterval
 	}
 
 	return &salesforceCollector{
-		receiver: rec,
-		shipper:  shipper,
-		interval: interval,
+		receiver:               rec,
+		shipper:                shipper,
+		streamingShipper:       streamingShipper,
+		cursor:                 cursor,
+		interval:               interval,
+		maxConcurrentDownloads: maxConcurrentDownloads,
+		logger:                 logger,
 	}, nil
 }
 
-func createSalesforceReceiver() (*receiver.SalesforceLogsReceiver, error) {
+// createLogger builds the collector's zap logger, honoring LOG_LEVEL ("debug", "info", "warn"
+// or "error"; defaults to "info") so operators can turn up verbosity in production without
+// recompiling.
+func createLogger() (*zap.Logger, error) {
+	level := zapcore.InfoLevel
+	if levelStr := os.Getenv(envNameLogLevel); levelStr != "" {
+		if err := level.UnmarshalText([]byte(levelStr)); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %w", envNameLogLevel, err)
+		}
+	}
+
+	config := zap.NewProductionConfig()
+	config.Level = zap.NewAtomicLevelAt(level)
+
+	return config.Build()
+}
+
+// newCorrelationID generates a short random ID to tag every log line produced while
+// collecting and shipping one cycle's records, so operators can trace a single Salesforce
+// record end-to-end from query to Logz.io ack.
+func newCorrelationID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return strconv.FormatInt(time.Now().Unix(), 36)
+	}
+
+	return hex.EncodeToString(buf)
+}
+
+func createCursor() receiver.Cursor {
+	cursorFilePath := os.Getenv(envNameCursorFilePath)
+	if cursorFilePath == "" {
+		cursorFilePath = defaultCursorFilePath
+	}
+
+	return receiver.NewFileCursor(cursorFilePath)
+}
+
+func createSalesforceReceiver(cursor receiver.Cursor, logger *zap.Logger) (*receiver.SalesforceLogsReceiver, error) {
 	sObjectTypesStr := os.Getenv(envNameSObjectTypes)
 	sObjectTypes := strings.Split(strings.Replace(sObjectTypesStr, " ", "", -1), ",")
-	latestTimestamp := os.Getenv(envNameFromTimestamp)
+	fromTimestamp := os.Getenv(envNameFromTimestamp)
+	fields := splitEnvList(os.Getenv(envNameSObjectFields))
+	where := os.Getenv(envNameSObjectWhere)
+	eventTypes := splitEnvList(os.Getenv(envNameEventLogEventTypes))
+	rowFilter := createEventLogRowFilter()
 
 	var sObjects []*receiver.SObjectToCollect
 	for _, sObjectType := range sObjectTypes {
+		latestTimestamp, err := cursor.Load(sObjectType)
+		if err != nil {
+			return nil, fmt.Errorf("error loading cursor for sObject %s: %w", sObjectType, err)
+		}
+
+		if latestTimestamp == "" {
+			latestTimestamp = fromTimestamp
+		}
+
 		sObjects = append(sObjects, &receiver.SObjectToCollect{
 			SObjectType:     sObjectType,
 			LatestTimestamp: latestTimestamp,
+			Fields:          fields,
+			Where:           where,
+			EventTypes:      eventTypes,
+			RowFilter:       rowFilter,
 		})
 	}
 
@@ -105,11 +210,10 @@ func createSalesforceReceiver() (*receiver.SalesforceLogsReceiver, error) {
 		os.Getenv(envNameSalesforceURL),
 		os.Getenv(envNameClientID),
 		os.Getenv(envNameApiVersion),
-		os.Getenv(envNameUsername),
-		os.Getenv(envNamePassword),
-		os.Getenv(envNameSecurityToken),
+		createAuthConfig(),
 		sObjects,
-		customFields)
+		customFields,
+		receiver.WithLogger(logger))
 	if err != nil {
 		return nil, fmt.Errorf("error creating Salesforce logs receiver object: %w", err)
 	}
@@ -121,6 +225,64 @@ func createSalesforceReceiver() (*receiver.SalesforceLogsReceiver, error) {
 	return rec, nil
 }
 
+// splitEnvList splits a comma-separated env var value into a slice, stripping spaces, and
+// returns nil (rather than a slice with one empty element) when the value is unset.
+func splitEnvList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	return strings.Split(strings.Replace(value, " ", "", -1), ",")
+}
+
+// createEventLogRowFilter builds a RowFilter from EVENT_LOG_ROW_FILTER, a comma-separated
+// list of "field=value" equality conditions that must all match for a log line to be kept,
+// e.g. "EVENT_TYPE=URI,USER_ID=005xx000001Sv6W".
+func createEventLogRowFilter() func(row map[string]interface{}) bool {
+	filterStr := os.Getenv(envNameEventLogRowFilter)
+	if filterStr == "" {
+		return nil
+	}
+
+	conditions := make(map[string]string)
+	for _, condition := range strings.Split(filterStr, ",") {
+		if !strings.Contains(condition, "=") {
+			continue
+		}
+
+		fieldAndValue := strings.SplitN(condition, "=", 2)
+		conditions[fieldAndValue[0]] = fieldAndValue[1]
+	}
+
+	return func(row map[string]interface{}) bool {
+		for field, wantValue := range conditions {
+			if fmt.Sprintf("%v", row[field]) != wantValue {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+func createAuthConfig() receiver.AuthConfig {
+	mode := receiver.AuthMode(os.Getenv(envNameAuthMode))
+	if mode == "" {
+		mode = receiver.AuthModePassword
+	}
+
+	return receiver.AuthConfig{
+		Mode:          mode,
+		Username:      os.Getenv(envNameUsername),
+		Password:      os.Getenv(envNamePassword),
+		SecurityToken: os.Getenv(envNameSecurityToken),
+		PrivateKeyPEM: os.Getenv(envNamePrivateKeyPEM),
+		ConsumerKey:   os.Getenv(envNameConsumerKey),
+		Subject:       os.Getenv(envNameSubject),
+		Audience:      os.Getenv(envNameAudience),
+	}
+}
+
 func createLogzioSender() (*logzio.LogzioSender, error) {
 	logzioListenerURL := os.Getenv(envNameLogzioListenerURL)
 	if logzioListenerURL == "" {
@@ -145,59 +307,182 @@ func createLogzioSender() (*logzio.LogzioSender, error) {
 	return shipper, nil
 }
 
+// collect fetches and ships records for every configured sObject type. sObject types run
+// concurrently, and downloads within a single sObject type (the expensive part for
+// EventLogFile records) run through a bounded worker pool sized by maxConcurrentDownloads, so
+// one sObject type with a backlog of records can't starve the others or blow through
+// Salesforce's per-user API call limits. Every record processed in this cycle is tagged with
+// the same correlation ID, so its logs can be traced end-to-end from query to Logz.io ack.
 func (sfc *salesforceCollector) collect() {
+	correlationID := newCorrelationID()
+	ctx := receiver.WithCorrelationID(context.Background(), correlationID)
+	logger := sfc.logger.With(zap.String("correlation_id", correlationID))
+
 	var waitGroup sync.WaitGroup
+	downloadSlots := make(chan struct{}, sfc.maxConcurrentDownloads)
 
 	for _, sObject := range sfc.receiver.SObjects {
 		waitGroup.Add(1)
 
 		go func(sObject *receiver.SObjectToCollect) {
 			defer waitGroup.Done()
+			sfc.collectSObject(ctx, logger, sObject, downloadSlots)
+		}(sObject)
+	}
 
-			records, err := sfc.receiver.GetSObjectRecords(sObject)
-			if err != nil {
-				errorLogger.Println("error getting sObject ", sObject.SObjectType, " records: ", err)
+	waitGroup.Wait()
+}
+
+// collectSObject downloads and ships every new record of a single sObject type, running one
+// download at a time per record but bounded across all sObject types by downloadSlots.
+func (sfc *salesforceCollector) collectSObject(ctx context.Context, logger *zap.Logger, sObject *receiver.SObjectToCollect, downloadSlots chan struct{}) {
+	records, err := sfc.receiver.GetSObjectRecords(ctx, sObject)
+	if err != nil {
+		sfc.reLoginIfUnauthorized(logger, err)
+		logger.Error("error getting sObject records", zap.String("sobject_type", sObject.SObjectType), zap.Error(err))
+		return
+	}
+
+	var recordsWaitGroup sync.WaitGroup
+	var latestTimestampMutex sync.Mutex
+	latestTimestamp := sObject.LatestTimestamp
+	anyFailed := false
+
+	for _, record := range records {
+		record := record
+		recordsWaitGroup.Add(1)
+
+		go func() {
+			defer recordsWaitGroup.Done()
+
+			downloadSlots <- struct{}{}
+			defer func() { <-downloadSlots }()
+
+			createdDate, ok := sfc.collectRecord(ctx, logger, sObject, &record)
+
+			latestTimestampMutex.Lock()
+			defer latestTimestampMutex.Unlock()
+
+			if !ok {
+				anyFailed = true
 				return
 			}
+			if createdDate > latestTimestamp {
+				latestTimestamp = createdDate
+			}
+		}()
+	}
+
+	recordsWaitGroup.Wait()
+
+	// A failed record within the batch must not be skipped permanently: since the next
+	// cycle queries "CreatedDate > latestTimestamp" (strictly greater), advancing the
+	// cursor past a record that never shipped would mean it's never retried. Leave the
+	// cursor untouched for this sObject type so the whole batch, failed records included,
+	// is re-fetched next cycle.
+	if anyFailed {
+		logger.Warn("not advancing cursor for sObject because at least one record failed this cycle, it will be retried next cycle",
+			zap.String("sobject_type", sObject.SObjectType))
+		return
+	}
+
+	if latestTimestamp == sObject.LatestTimestamp {
+		return
+	}
+
+	sObject.LatestTimestamp = latestTimestamp
+	if err = sfc.cursor.Save(sObject.SObjectType, sObject.LatestTimestamp); err != nil {
+		logger.Error("error saving cursor for sObject", zap.String("sobject_type", sObject.SObjectType), zap.Error(err))
+	}
+}
+
+// collectRecord downloads, enriches and ships a single record, returning its CreatedDate and
+// whether it was shipped successfully.
+func (sfc *salesforceCollector) collectRecord(ctx context.Context, logger *zap.Logger, sObject *receiver.SObjectToCollect, record *simpleforce.SObject) (string, bool) {
+	recordLogger := logger.With(zap.String("sobject_type", sObject.SObjectType), zap.String("record_id", record.ID()))
+
+	data, createdDate, err := sfc.receiver.CollectSObjectRecord(ctx, record)
+	if err != nil {
+		recordLogger.Error("error collecting sObject record", zap.Error(err))
+		return "", false
+	}
 
-			for _, record := range records {
-				data, createdDate, err := sfc.receiver.CollectSObjectRecord(&record)
-				if err != nil {
-					errorLogger.Println("error collecting sObject ", sObject.SObjectType, " record ID ", record.ID(), ": ", err)
-					return
-				}
-
-				if strings.ToLower(sObject.SObjectType) == receiver.EventLogFileSObjectName {
-					enrichedData, err := sfc.receiver.EnrichEventLogFileSObjectData(&record, data)
-					if err != nil {
-						errorLogger.Println("error enriching EventLogFile sObject ", " record ID ", record.ID(), ": ", err)
-						return
-					}
-
-					for _, data = range enrichedData {
-						if !sfc.sendDataToLogzio(data, sObject.SObjectType, record.ID()) {
-							return
-						}
-					}
-				} else {
-					if !sfc.sendDataToLogzio(data, sObject.SObjectType, record.ID()) {
-						return
-					}
-				}
-
-				sObject.LatestTimestamp = *createdDate
+	if strings.ToLower(sObject.SObjectType) == receiver.EventLogFileSObjectName {
+		enrichedData, err := sfc.receiver.EnrichEventLogFileSObjectData(ctx, sObject, record, data)
+		if err != nil {
+			sfc.reLoginIfUnauthorized(logger, err)
+			recordLogger.Error("error enriching EventLogFile sObject record", zap.Error(err))
+			return "", false
+		}
+
+		for _, data = range enrichedData {
+			if !sfc.sendDataToLogzio(recordLogger, data, sObject.SObjectType, record.ID()) {
+				return "", false
 			}
-		}(sObject)
+		}
+	} else if !sfc.sendDataToLogzio(recordLogger, data, sObject.SObjectType, record.ID()) {
+		return "", false
+	}
+
+	return *createdDate, true
+}
 
-		waitGroup.Wait()
+// reLoginIfUnauthorized re-authenticates against Salesforce when err indicates the access
+// token was rejected, so the next collection cycle doesn't keep failing with a stale token.
+func (sfc *salesforceCollector) reLoginIfUnauthorized(logger *zap.Logger, err error) {
+	if !errors.Is(err, receiver.ErrUnauthorized) {
+		return
 	}
 
-	sfc.shipper.Stop()
+	logger.Info("access token rejected, logging in to Salesforce again")
+	if loginErr := sfc.receiver.LoginSalesforce(); loginErr != nil {
+		logger.Error("error logging in to Salesforce again", zap.Error(loginErr))
+	}
 }
 
-func (sfc *salesforceCollector) sendDataToLogzio(data []byte, sObjectName string, sObjectRecordID string) bool {
-	if err := sfc.shipper.Send(data); err != nil {
-		errorLogger.Println("error sending sObject ", sObjectName, " record ID ", sObjectRecordID, " to Logz.io: ", err)
+// runStreaming subscribes to the configured Streaming API channels and forwards every
+// message straight to Logz.io, giving near-real-time delivery alongside the polling loop in
+// collect(). It blocks and is meant to be run in its own goroutine.
+func (sfc *salesforceCollector) runStreaming(channels []string) {
+	subscriber := sfc.receiver.NewSubscriber(channels, sfc.cursor)
+	events := make(chan receiver.StreamEvent, 100)
+
+	go func() {
+		for event := range events {
+			data, err := json.Marshal(event.Data)
+			if err != nil {
+				sfc.logger.Error("error marshaling streaming event", zap.String("event_type", event.Channel), zap.Error(err))
+				continue
+			}
+
+			sendDataToLogzio(sfc.streamingShipper, sfc.logger, data, event.Channel, strconv.FormatInt(event.ReplayID, 10))
+		}
+	}()
+
+	if err := subscriber.Run(nil, events); err != nil {
+		sfc.logger.Error("error running streaming subscriber", zap.Error(err))
+	}
+}
+
+func streamingChannels() []string {
+	channelsStr := os.Getenv(envNameStreamingChannels)
+	if channelsStr == "" {
+		return nil
+	}
+
+	return strings.Split(strings.Replace(channelsStr, " ", "", -1), ",")
+}
+
+func (sfc *salesforceCollector) sendDataToLogzio(logger *zap.Logger, data []byte, sObjectName string, sObjectRecordID string) bool {
+	return sendDataToLogzio(sfc.shipper, logger, data, sObjectName, sObjectRecordID)
+}
+
+func sendDataToLogzio(shipper *logzio.LogzioSender, logger *zap.Logger, data []byte, sObjectName string, sObjectRecordID string) bool {
+	if err := shipper.Send(data); err != nil {
+		logger.Error("error sending sObject record to Logz.io",
+			zap.String("sobject_type", sObjectName),
+			zap.String("record_id", sObjectRecordID),
+			zap.Error(err))
 		return false
 	}
 
@@ -210,6 +495,10 @@ func main() {
 		panic(err)
 	}
 
+	if channels := streamingChannels(); len(channels) > 0 {
+		go collector.runStreaming(channels)
+	}
+
 	for {
 		collector.collect()
 		time.Sleep(time.Duration(collector.interval) * time.Second)
@@ -0,0 +1,45 @@
+package salesforce_logs_receiver
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// Option configures optional behavior of a SalesforceLogsReceiver.
+type Option func(*SalesforceLogsReceiver)
+
+// WithLogger injects a structured zap logger, replacing the package's default no-op logger.
+// Without it the receiver logs nothing. Use it to get query and download events as structured
+// fields (sobject_type, record_id, event_type, attempt, duration_ms, status_code).
+func WithLogger(logger *zap.Logger) Option {
+	return func(slr *SalesforceLogsReceiver) {
+		slr.logger = logger
+	}
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context carrying a correlation ID, so every log line emitted
+// while handling one collection cycle - from SOQL query to EventLogFile download to Logz.io
+// send - can be traced back to that cycle.
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// CorrelationIDFromContext returns the correlation ID carried by ctx, or "" if none was set
+// with WithCorrelationID.
+func CorrelationIDFromContext(ctx context.Context) string {
+	correlationID, _ := ctx.Value(correlationIDKey{}).(string)
+	return correlationID
+}
+
+// loggerFrom returns the receiver's logger, annotated with the correlation ID carried by ctx
+// if any.
+func (slr *SalesforceLogsReceiver) loggerFrom(ctx context.Context) *zap.Logger {
+	if correlationID := CorrelationIDFromContext(ctx); correlationID != "" {
+		return slr.logger.With(zap.String("correlation_id", correlationID))
+	}
+
+	return slr.logger
+}
@@ -2,67 +2,114 @@ package salesforce_logs_receiver
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"log"
 	"net/http"
-	"os"
-	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/avast/retry-go"
 	"github.com/simpleforce/simpleforce"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
 )
 
 const (
 	EventLogFileSObjectName = "eventlogfile"
 	defaultApiVersion       = "55.0"
-)
+	sforceLocatorHeader     = "Sforce-Locator"
+	sforceLimitInfoHeader   = "Sforce-Limit-Info"
 
-var (
-	debugLogger = log.New(os.Stderr, "DEBUG: ", log.Ldate|log.Ltime)
+	// apiUsageBackoffThreshold is the fraction of the org's daily API allotment at which
+	// downloads are throttled down to a crawl rather than risking the org getting locked out.
+	apiUsageBackoffThreshold = 0.8
+	backoffDownloadRate      = rate.Limit(1.0 / 10.0) // one download every 10 seconds
 )
 
+// ErrUnauthorized is returned (wrapped) by getFileContent when Salesforce responds with
+// 401, meaning the access token has expired or been revoked and callers should re-login
+// rather than retry the request as-is.
+var ErrUnauthorized = errors.New("salesforce API returned 401 unauthorized")
+
+// HTTPStatusError is returned when a Salesforce HTTP response does not indicate terminal
+// success. StatusCode lets callers distinguish retryable server errors from non-retryable
+// client errors.
+type HTTPStatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("statuscode: %d, body: %s", e.StatusCode, e.Body)
+}
+
 type SalesforceLogsReceiver struct {
-	SObjects      []*SObjectToCollect
-	username      string
-	password      string
-	securityToken string
-	customFields  map[string]string
-	client        *simpleforce.Client
+	SObjects []*SObjectToCollect
+	// DownloadLimiter paces EventLogFile download requests. It is unlimited by default and
+	// automatically throttled down when the org's Sforce-Limit-Info header reports API usage
+	// nearing apiUsageBackoffThreshold, then restored once usage drops back under it; callers
+	// can also set their own limit up front, e.g. sized from MAX_CONCURRENT_DOWNLOADS, via
+	// SetDownloadRate rather than calling DownloadLimiter.SetLimit directly so that limit is
+	// remembered as the rate to restore.
+	DownloadLimiter *rate.Limiter
+
+	normalDownloadRate rate.Limit
+
+	url          string
+	apiVersion   string
+	auth         AuthConfig
+	customFields map[string]string
+	client       *simpleforce.Client
+	// clientMutex guards every read and write of client's session state (its sessionID and
+	// instanceURL, surfaced via LoginSalesforce/SetSidLoc and GetSid/GetLoc). simpleforce.Client
+	// isn't safe for concurrent use on its own, and LoginSalesforce can now be called
+	// concurrently from multiple sObject/record goroutines (reLoginIfUnauthorized), the
+	// polling loop's periodic re-login, and a long-lived streaming Subscriber all at once.
+	clientMutex sync.RWMutex
+	logger      *zap.Logger
 }
 
 type SObjectToCollect struct {
 	SObjectType     string
 	LatestTimestamp string
+
+	// Fields, if set, overrides the default "Id,CreatedDate" SOQL field list. Id and
+	// CreatedDate are always included even if omitted here. CollectSObjectRecord still fetches
+	// each record's full data with a separate REST call, whatever Fields holds.
+	Fields []string
+	// Where, if set, is appended to the SOQL query as an additional "AND" condition, letting
+	// callers push filters (e.g. by user or org) down into Salesforce instead of fetching and
+	// discarding records.
+	Where string
+	// EventTypes, for EventLogFile sObjects only, is translated to an
+	// "AND EventType IN (...)" SOQL condition.
+	EventTypes []string
+
+	// RowFilter, if set, is called once per EventLogFile log line (already parsed into a
+	// field map); a row is dropped before being shipped to Logz.io unless RowFilter returns
+	// true for it.
+	RowFilter func(row map[string]interface{}) bool
 }
 
 func NewSalesforceLogsReceiver(
 	url string,
 	clientID string,
 	apiVersion string,
-	username string,
-	password string,
-	securityToken string,
+	auth AuthConfig,
 	sObjects []*SObjectToCollect,
-	customFields map[string]string) (*SalesforceLogsReceiver, error) {
+	customFields map[string]string,
+	opts ...Option) (*SalesforceLogsReceiver, error) {
 	if clientID == "" {
 		return nil, fmt.Errorf("client ID must have a value")
 	}
 
-	if username == "" {
-		return nil, fmt.Errorf("username must have a value")
-	}
-
-	if password == "" {
-		return nil, fmt.Errorf("password must have a value")
-	}
-
-	if securityToken == "" {
-		return nil, fmt.Errorf("security token must have a value")
+	if err := auth.validate(); err != nil {
+		return nil, err
 	}
 
 	if len(sObjects) == 0 {
@@ -97,37 +144,138 @@ func NewSalesforceLogsReceiver(
 		return nil, fmt.Errorf("error creating Salesforce client")
 	}
 
-	return &SalesforceLogsReceiver{
-		SObjects:      sObjects,
-		username:      username,
-		password:      password,
-		securityToken: securityToken,
-		customFields:  customFields,
-		client:        client,
-	}, nil
+	slr := &SalesforceLogsReceiver{
+		SObjects:           sObjects,
+		DownloadLimiter:    rate.NewLimiter(rate.Inf, 1),
+		normalDownloadRate: rate.Inf,
+		url:                url,
+		apiVersion:         apiVersion,
+		auth:               auth,
+		customFields:       customFields,
+		client:             client,
+		logger:             zap.NewNop(),
+	}
+
+	for _, opt := range opts {
+		opt(slr)
+	}
+
+	return slr, nil
+}
+
+// SetDownloadRate sets the EventLogFile download rate limit and burst, and remembers the limit
+// as the rate to restore once an API-usage backoff (see applyLimitInfo) ends. Callers should use
+// this instead of calling DownloadLimiter.SetLimit directly.
+func (slr *SalesforceLogsReceiver) SetDownloadRate(limit rate.Limit, burst int) {
+	slr.normalDownloadRate = limit
+	slr.DownloadLimiter.SetLimit(limit)
+	slr.DownloadLimiter.SetBurst(burst)
 }
 
+// LoginSalesforce authenticates against Salesforce and stores the resulting session on the
+// underlying client. It holds clientMutex for the duration of the call, so it's safe to call
+// concurrently with itself and with any in-flight request that reads the client's session state.
 func (slr *SalesforceLogsReceiver) LoginSalesforce() error {
-	if err := slr.client.LoginPassword(slr.username, slr.password, slr.securityToken); err != nil {
-		return fmt.Errorf("error login Salesforce API: %w", err)
+	slr.clientMutex.Lock()
+	defer slr.clientMutex.Unlock()
+
+	if slr.auth.Mode == AuthModeJWT {
+		if err := slr.loginJWT(); err != nil {
+			return fmt.Errorf("error login Salesforce API with JWT bearer flow: %w", err)
+		}
+	} else {
+		if err := slr.client.LoginPassword(slr.auth.Username, slr.auth.Password, slr.auth.SecurityToken); err != nil {
+			return fmt.Errorf("error login Salesforce API: %w", err)
+		}
 	}
 
-	debugLogger.Println("Logged in to Salesforce. Got new access token")
+	slr.logger.Info("logged in to Salesforce, got new access token")
 	return nil
 }
 
-func (slr *SalesforceLogsReceiver) GetSObjectRecords(sObject *SObjectToCollect) ([]simpleforce.SObject, error) {
-	query := fmt.Sprintf("SELECT Id,CreatedDate FROM %s WHERE CreatedDate > %s", sObject.SObjectType, sObject.LatestTimestamp)
-	result, err := slr.client.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("error querying Salesforce API: %w", err)
+// GetSObjectRecords runs the SOQL query for sObject and follows nextRecordsUrl
+// pagination (simpleforce.Client.Query re-invoked with NextRecordsURL) until the result set is
+// exhausted, so queries matching more than one page of results don't silently drop records.
+func (slr *SalesforceLogsReceiver) GetSObjectRecords(ctx context.Context, sObject *SObjectToCollect) ([]simpleforce.SObject, error) {
+	query := buildSOQLQuery(sObject)
+
+	var records []simpleforce.SObject
+	for {
+		slr.clientMutex.RLock()
+		result, err := slr.client.Query(query)
+		slr.clientMutex.RUnlock()
+		if err != nil {
+			return nil, fmt.Errorf("error querying Salesforce API: %w", err)
+		}
+
+		records = append(records, result.Records...)
+		if result.Done || result.NextRecordsURL == "" {
+			break
+		}
+
+		query = result.NextRecordsURL
 	}
 
-	debugLogger.Println("Got", len(result.Records), "records of sObject", sObject.SObjectType)
-	return result.Records, nil
+	slr.loggerFrom(ctx).Debug("queried sObject records",
+		zap.String("sobject_type", sObject.SObjectType),
+		zap.Int("record_count", len(records)))
+	return records, nil
 }
 
-func (slr *SalesforceLogsReceiver) CollectSObjectRecord(record *simpleforce.SObject) ([]byte, *string, error) {
+// buildSOQLQuery builds the SOQL query for a sObject, projecting sObject.Fields (defaulting
+// to "Id,CreatedDate") and pushing sObject.Where and, for EventLogFile, sObject.EventTypes
+// down as additional "AND" conditions instead of filtering client-side.
+func buildSOQLQuery(sObject *SObjectToCollect) string {
+	fields := soqlFieldList(sObject.Fields)
+
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE CreatedDate > %s", fields, sObject.SObjectType, sObject.LatestTimestamp)
+
+	if strings.ToLower(sObject.SObjectType) == EventLogFileSObjectName && len(sObject.EventTypes) > 0 {
+		query += fmt.Sprintf(" AND EventType IN (%s)", soqlQuotedList(sObject.EventTypes))
+	}
+
+	if sObject.Where != "" {
+		query += " AND " + sObject.Where
+	}
+
+	return query
+}
+
+// soqlFieldList builds the SOQL field projection for a query, always including Id and
+// CreatedDate since CollectSObjectRecord and the cursor both rely on them.
+func soqlFieldList(fields []string) string {
+	hasID, hasCreatedDate := false, false
+	for _, field := range fields {
+		switch strings.ToLower(field) {
+		case "id":
+			hasID = true
+		case "createddate":
+			hasCreatedDate = true
+		}
+	}
+
+	if !hasID {
+		fields = append([]string{"Id"}, fields...)
+	}
+	if !hasCreatedDate {
+		fields = append(fields, "CreatedDate")
+	}
+
+	return strings.Join(fields, ",")
+}
+
+// soqlQuotedList renders values as a comma-separated list of single-quoted SOQL string
+// literals, e.g. for use in an "IN (...)" condition.
+func soqlQuotedList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + strings.Replace(value, "'", "\\'", -1) + "'"
+	}
+
+	return strings.Join(quoted, ",")
+}
+
+func (slr *SalesforceLogsReceiver) CollectSObjectRecord(ctx context.Context, record *simpleforce.SObject) ([]byte, *string, error) {
 	id := record.ID()
 	data := record.Get(id)
 
@@ -144,7 +292,9 @@ func (slr *SalesforceLogsReceiver) CollectSObjectRecord(record *simpleforce.SObj
 	createdDate := record.StringField("CreatedDate")
 	createdDate = strings.Replace(createdDate, "+0000", "Z", 1)
 
-	debugLogger.Println("Collected data of sObject", record.Type(), "record ID", id)
+	slr.loggerFrom(ctx).Debug("collected sObject record",
+		zap.String("sobject_type", record.Type()),
+		zap.String("record_id", id))
 	return jsonData, &createdDate, nil
 }
 
@@ -170,13 +320,20 @@ func (slr *SalesforceLogsReceiver) addCustomFields(jsonData []byte) ([]byte, err
 	return newJsonData, nil
 }
 
-func (slr *SalesforceLogsReceiver) EnrichEventLogFileSObjectData(data *simpleforce.SObject, jsonData []byte) ([][]byte, error) {
-	eventLogRows, err := slr.getEventLogFileContent(data)
+// EnrichEventLogFileSObjectData downloads an EventLogFile sObject's log file and returns one
+// JSON document per log line, merged into jsonData. If sObject.RowFilter is set, log lines it
+// rejects are dropped before being returned, reducing ingestion volume; the whole log file is
+// still downloaded.
+func (slr *SalesforceLogsReceiver) EnrichEventLogFileSObjectData(ctx context.Context, sObject *SObjectToCollect, data *simpleforce.SObject, jsonData []byte) ([][]byte, error) {
+	eventLogRows, err := slr.getEventLogFileContent(ctx, sObject, data)
 	if err != nil {
 		return nil, fmt.Errorf("error getting EventLogFile sObject log file content: %w", err)
 	}
 
-	debugLogger.Println("Got", len(eventLogRows), "events from EventLogFile sObject ID", data.ID())
+	logger := slr.loggerFrom(ctx).With(
+		zap.String("sobject_type", EventLogFileSObjectName),
+		zap.String("record_id", data.ID()))
+	logger.Debug("got events from EventLogFile sObject", zap.Int("event_count", len(eventLogRows)))
 
 	var jsonsData [][]byte
 	for _, eventLogRow := range eventLogRows {
@@ -188,19 +345,21 @@ func (slr *SalesforceLogsReceiver) EnrichEventLogFileSObjectData(data *simplefor
 		jsonsData = append(jsonsData, newJsonData)
 	}
 
-	debugLogger.Println("Enriched JSON data with", len(jsonsData), "events from EventLogFile sObject ID", data.ID())
+	logger.Debug("enriched JSON data with events from EventLogFile sObject", zap.Int("event_count", len(jsonsData)))
 	return jsonsData, nil
 }
 
-func (slr *SalesforceLogsReceiver) getEventLogFileContent(data *simpleforce.SObject) ([]map[string]interface{}, error) {
+func (slr *SalesforceLogsReceiver) getEventLogFileContent(ctx context.Context, sObject *SObjectToCollect, data *simpleforce.SObject) ([]map[string]interface{}, error) {
 	apiPath := data.StringField("LogFile")
-	logFileContent, err := slr.getFileContent(apiPath)
+	logFileContent, err := slr.getFileContent(ctx, apiPath)
 	if err != nil {
 		return nil, fmt.Errorf("error getting event log file content: %w", err)
 	}
 
 	trimmedLogFileContent := strings.Replace(string(logFileContent), "\n\n", "\n", -1)
-	debugLogger.Println("Got EventLogFile sObject log file content ID", data.ID())
+	slr.loggerFrom(ctx).Debug("got EventLogFile sObject log file content",
+		zap.String("sobject_type", EventLogFileSObjectName),
+		zap.String("record_id", data.ID()))
 
 	reader := strings.NewReader(trimmedLogFileContent)
 	csvReader := csv.NewReader(reader)
@@ -222,61 +381,190 @@ func (slr *SalesforceLogsReceiver) getEventLogFileContent(data *simpleforce.SObj
 			logEvent[key] = field
 		}
 
+		if sObject.RowFilter != nil && !sObject.RowFilter(logEvent) {
+			continue
+		}
+
 		logEvents = append(logEvents, logEvent)
 	}
 
 	return logEvents, nil
 }
 
-func (slr *SalesforceLogsReceiver) getFileContent(apiPath string) ([]byte, error) {
+// getFileContent downloads the full content of a Salesforce file API path, following
+// Sforce-Locator pagination for large EventLogFile downloads and concatenating the CSV
+// chunks together, skipping the header row on every chunk after the first.
+func (slr *SalesforceLogsReceiver) getFileContent(ctx context.Context, apiPath string) ([]byte, error) {
+	var fullContent bytes.Buffer
+	locator := ""
+
+	for isFirstChunk := true; isFirstChunk || locator != ""; isFirstChunk = false {
+		chunk, nextLocator, err := slr.getFileContentChunk(ctx, apiPath, locator)
+		if err != nil {
+			return nil, err
+		}
+
+		if isFirstChunk {
+			fullContent.Write(chunk)
+		} else {
+			fullContent.Write(dropCsvHeaderRow(chunk))
+		}
+
+		locator = nextLocator
+	}
+
+	return fullContent.Bytes(), nil
+}
+
+// getFileContentChunk fetches a single page of a file API path and returns the Sforce-Locator
+// of the next page, if any. Only an exact 200 is treated as terminal success: 5xx responses
+// are retried, while 4xx responses are not, with 401 wrapped in ErrUnauthorized so callers can
+// trigger a re-login instead of giving up outright.
+func (slr *SalesforceLogsReceiver) getFileContentChunk(ctx context.Context, apiPath string, locator string) ([]byte, string, error) {
 	httpClient := &http.Client{}
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s%s", strings.TrimRight(slr.client.GetLoc(), "/"), apiPath), nil)
-	req.Header.Add("Content-Type", "application/json; charset=UTF-8")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", "Bearer "+slr.client.GetSid())
+	slr.clientMutex.RLock()
+	url := fmt.Sprintf("%s%s", strings.TrimRight(slr.client.GetLoc(), "/"), apiPath)
+	slr.clientMutex.RUnlock()
+	if locator != "" {
+		url = fmt.Sprintf("%s?locator=%s", url, locator)
+	}
 
-	var resp *http.Response
-	err = retry.Do(
+	logger := slr.loggerFrom(ctx)
+
+	var content []byte
+	var nextLocator string
+	attempt := 0
+
+	err := retry.Do(
 		func() error {
-			resp, err = httpClient.Do(req)
+			attempt++
+			start := time.Now()
+
+			if err := slr.DownloadLimiter.Wait(context.Background()); err != nil {
+				return retry.Unrecoverable(err)
+			}
+
+			req, err := http.NewRequest("GET", url, nil)
+			if err != nil {
+				return retry.Unrecoverable(err)
+			}
+			req.Header.Add("Content-Type", "application/json; charset=UTF-8")
+			req.Header.Add("Accept", "application/json")
+			slr.clientMutex.RLock()
+			req.Header.Add("Authorization", "Bearer "+slr.client.GetSid())
+			slr.clientMutex.RUnlock()
+
+			resp, err := httpClient.Do(req)
 			if err != nil {
 				return err
 			}
+			defer resp.Body.Close()
 
-			if resp.StatusCode < 200 || resp.StatusCode > 299 {
-				buf := new(bytes.Buffer)
-				buf.ReadFrom(resp.Body)
-				return fmt.Errorf("ERROR: statuscode: %d, body: %s", resp.StatusCode, buf.String())
+			slr.applyLimitInfo(ctx, resp.Header.Get(sforceLimitInfoHeader))
+
+			buf := new(bytes.Buffer)
+			if _, err = buf.ReadFrom(resp.Body); err != nil {
+				return err
 			}
 
-			return nil
-		},
-		retry.RetryIf(
-			func(err error) bool {
-				result, matchErr := regexp.MatchString("statuscode: 5[0-9]{2}", err.Error())
-				if matchErr != nil {
-					return false
+			logger.Debug("fetched file content chunk",
+				zap.Int("attempt", attempt),
+				zap.Int("status_code", resp.StatusCode),
+				zap.Int64("duration_ms", time.Since(start).Milliseconds()))
+
+			if resp.StatusCode != http.StatusOK {
+				statusErr := &HTTPStatusError{StatusCode: resp.StatusCode, Body: buf.String()}
+				if resp.StatusCode == http.StatusUnauthorized {
+					return retry.Unrecoverable(fmt.Errorf("%w: %s", ErrUnauthorized, statusErr))
 				}
-				if result {
-					return true
+				if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+					return retry.Unrecoverable(statusErr)
 				}
 
-				return false
-			}),
+				return statusErr
+			}
+
+			content = buf.Bytes()
+			nextLocator = resp.Header.Get(sforceLocatorHeader)
+			if nextLocator == "null" {
+				nextLocator = ""
+			}
+
+			return nil
+		},
 		retry.DelayType(retry.BackOffDelay),
 		retry.Attempts(3),
 	)
 	if err != nil {
-		return nil, err
+		return nil, "", err
 	}
 
-	var content []byte
-	content, err = io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	return content, nextLocator, nil
+}
+
+// applyLimitInfo backs the download limiter off to a crawl once the org's Sforce-Limit-Info
+// header shows usage nearing the daily API allotment, so the collector doesn't get the whole
+// org locked out of the API, and restores it to the configured normalDownloadRate once usage
+// drops back under apiUsageBackoffThreshold (e.g. after the org's daily allotment resets).
+// headerValue is expected in the form "api-usage=18000/20000".
+func (slr *SalesforceLogsReceiver) applyLimitInfo(ctx context.Context, headerValue string) {
+	used, total, ok := parseApiUsage(headerValue)
+	if !ok {
+		return
+	}
+
+	usage := float64(used) / float64(total)
+	backedOff := slr.DownloadLimiter.Limit() == backoffDownloadRate
+
+	if usage >= apiUsageBackoffThreshold {
+		if backedOff {
+			return
+		}
+
+		slr.loggerFrom(ctx).Warn("Salesforce API usage nearing daily allotment, backing off EventLogFile downloads",
+			zap.Int("api_usage_used", used),
+			zap.Int("api_usage_total", total))
+		slr.DownloadLimiter.SetLimit(backoffDownloadRate)
+		return
+	}
+
+	if backedOff {
+		slr.loggerFrom(ctx).Info("Salesforce API usage back under daily allotment threshold, restoring EventLogFile download rate",
+			zap.Int("api_usage_used", used),
+			zap.Int("api_usage_total", total))
+		slr.DownloadLimiter.SetLimit(slr.normalDownloadRate)
+	}
+}
+
+func parseApiUsage(headerValue string) (used int, total int, ok bool) {
+	const prefix = "api-usage="
+
+	if !strings.HasPrefix(headerValue, prefix) {
+		return 0, 0, false
 	}
 
-	return content, nil
+	usageParts := strings.SplitN(strings.TrimPrefix(headerValue, prefix), "/", 2)
+	if len(usageParts) != 2 {
+		return 0, 0, false
+	}
+
+	used, usedErr := strconv.Atoi(usageParts[0])
+	total, totalErr := strconv.Atoi(usageParts[1])
+	if usedErr != nil || totalErr != nil || total == 0 {
+		return 0, 0, false
+	}
+
+	return used, total, true
+}
+
+// dropCsvHeaderRow removes the first line of a CSV chunk so header rows from paginated
+// EventLogFile downloads aren't duplicated when the chunks are concatenated.
+func dropCsvHeaderRow(csvChunk []byte) []byte {
+	if i := bytes.IndexByte(csvChunk, '\n'); i >= 0 {
+		return csvChunk[i+1:]
+	}
+
+	return nil
 }
 
 func addEventLogToJsonData(eventLog map[string]interface{}, jsonData []byte) ([]byte, error) {
@@ -0,0 +1,98 @@
+package salesforce_logs_receiver
+
+import "testing"
+
+func TestBuildSOQLQuery(t *testing.T) {
+	tests := []struct {
+		name    string
+		sObject *SObjectToCollect
+		want    string
+	}{
+		{
+			name:    "default fields",
+			sObject: &SObjectToCollect{SObjectType: "EventLogFile", LatestTimestamp: "2023-01-01T00:00:00.000Z"},
+			want:    "SELECT Id,CreatedDate FROM EventLogFile WHERE CreatedDate > 2023-01-01T00:00:00.000Z",
+		},
+		{
+			name: "custom fields, where and event types",
+			sObject: &SObjectToCollect{
+				SObjectType:     "EventLogFile",
+				LatestTimestamp: "2023-01-01T00:00:00.000Z",
+				Fields:          []string{"LogFile"},
+				Where:           "Interval = 'Hourly'",
+				EventTypes:      []string{"URI", "API"},
+			},
+			want: "SELECT Id,LogFile,CreatedDate FROM EventLogFile WHERE CreatedDate > 2023-01-01T00:00:00.000Z" +
+				" AND EventType IN ('URI','API') AND Interval = 'Hourly'",
+		},
+		{
+			name: "event types ignored for non-EventLogFile sObjects",
+			sObject: &SObjectToCollect{
+				SObjectType:     "LoginEvent",
+				LatestTimestamp: "2023-01-01T00:00:00.000Z",
+				EventTypes:      []string{"URI"},
+			},
+			want: "SELECT Id,CreatedDate FROM LoginEvent WHERE CreatedDate > 2023-01-01T00:00:00.000Z",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildSOQLQuery(tt.sObject); got != tt.want {
+				t.Errorf("buildSOQLQuery() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSoqlFieldList(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		want   string
+	}{
+		{name: "nil fields get defaults", fields: nil, want: "Id,CreatedDate"},
+		{name: "custom field gets Id prepended and CreatedDate appended", fields: []string{"LogFile"}, want: "Id,LogFile,CreatedDate"},
+		{name: "Id and CreatedDate not duplicated", fields: []string{"Id", "CreatedDate", "LogFile"}, want: "Id,CreatedDate,LogFile"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := soqlFieldList(tt.fields); got != tt.want {
+				t.Errorf("soqlFieldList(%v) = %q, want %q", tt.fields, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseApiUsage(t *testing.T) {
+	tests := []struct {
+		name       string
+		headerVal  string
+		wantUsed   int
+		wantTotal  int
+		wantParsed bool
+	}{
+		{name: "valid header", headerVal: "api-usage=18000/20000", wantUsed: 18000, wantTotal: 20000, wantParsed: true},
+		{name: "missing prefix", headerVal: "18000/20000", wantParsed: false},
+		{name: "missing slash", headerVal: "api-usage=18000", wantParsed: false},
+		{name: "non-numeric", headerVal: "api-usage=a/b", wantParsed: false},
+		{name: "zero total", headerVal: "api-usage=0/0", wantParsed: false},
+		{name: "empty", headerVal: "", wantParsed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			used, total, ok := parseApiUsage(tt.headerVal)
+			if ok != tt.wantParsed {
+				t.Fatalf("parseApiUsage(%q) ok = %v, want %v", tt.headerVal, ok, tt.wantParsed)
+			}
+			if !ok {
+				return
+			}
+			if used != tt.wantUsed || total != tt.wantTotal {
+				t.Errorf("parseApiUsage(%q) = %d, %d, want %d, %d", tt.headerVal, used, total, tt.wantUsed, tt.wantTotal)
+			}
+		})
+	}
+}